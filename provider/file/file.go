@@ -1,34 +1,79 @@
 package file
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"text/template"
+	"time"
 
+	"github.com/Masterminds/sprig"
 	"github.com/containous/traefik/config"
 	"github.com/containous/traefik/log"
 	"github.com/containous/traefik/provider"
 	"github.com/containous/traefik/safe"
 	"github.com/containous/traefik/tls"
 	"github.com/containous/traefik/types"
+	"github.com/pelletier/go-toml"
 	"github.com/pkg/errors"
 	"gopkg.in/fsnotify.v1"
+	"gopkg.in/yaml.v2"
 )
 
 const providerName = "file"
 
+// Supported configuration formats, selected from the file extension.
+const (
+	formatTOML = "toml"
+	formatYAML = "yaml"
+	formatJSON = "json"
+)
+
+// supportedExtensions lists the file extensions the directory loader picks up.
+var supportedExtensions = []string{".toml", ".tmpl", ".yaml", ".yml", ".json"}
+
+// defaultDebounceInterval is used when Provider.DebounceInterval is unset.
+const defaultDebounceInterval = 200 * time.Millisecond
+
+// Conflict policies for duplicate router/middleware/service names across files.
+const (
+	// ConflictPolicySkip keeps the first definition of a duplicate name and logs a warning. Default.
+	ConflictPolicySkip = "skip"
+	// ConflictPolicyOverride lets later files win over earlier ones.
+	ConflictPolicyOverride = "override"
+	// ConflictPolicyError fails the load as soon as a duplicate name is found.
+	ConflictPolicyError = "error"
+)
+
 var _ provider.Provider = (*Provider)(nil)
 
 // Provider holds configurations of the provider.
 type Provider struct {
 	provider.BaseProvider `mapstructure:",squash" export:"true"`
-	Directory             string `description:"Load configuration from one or more .toml files in a directory" export:"true"`
+	Directory             string        `description:"Load configuration from one or more .toml, .yaml, .yml, .json or .tmpl files in a directory" export:"true"`
 	TraefikFile           string
+	DebounceInterval      time.Duration `description:"Debounce interval for coalescing filesystem events before triggering a configuration reload (default 200ms)" export:"true"`
+	ConflictPolicy        string        `description:"Policy for resolving duplicate router/middleware/service names across files: skip, override or error (default skip)" export:"true"`
+	// TemplateFuncs registers additional functions available when rendering configuration files as
+	// Go templates. Precedence, lowest to highest: sprig.TxtFuncMap() plus "normalize" < the built-in
+	// env/envOrDefault/file/split/join/trim helpers < TemplateFuncs, so entries here win on name clashes.
+	TemplateFuncs template.FuncMap
+}
+
+// conflictPolicy returns the configured conflict policy, defaulting to ConflictPolicySkip
+// (the historical behavior) when unset.
+func (p *Provider) conflictPolicy() string {
+	if p.ConflictPolicy == "" {
+		return ConflictPolicySkip
+	}
+	return p.ConflictPolicy
 }
 
 // Init the provider
@@ -85,24 +130,55 @@ func (p *Provider) BuildConfiguration() (*config.Configuration, error) {
 	return nil, errors.New("error using file configuration backend, no filename defined")
 }
 
+// addRecursiveWatches walks the tree rooted at root and registers a watch on every directory found.
+func addRecursiveWatches(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(walkPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return watcher.Add(walkPath)
+		}
+		return nil
+	})
+}
+
 func (p *Provider) addWatcher(pool *safe.Pool, directory string, configurationChan chan<- config.Message, callback func(chan<- config.Message, fsnotify.Event)) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return fmt.Errorf("error creating file watcher: %s", err)
 	}
 
-	err = watcher.Add(directory)
-	if err != nil {
+	if err := addRecursiveWatches(watcher, directory); err != nil {
 		return fmt.Errorf("error adding file watcher: %s", err)
 	}
 
-	// Process events
+	debounceInterval := p.DebounceInterval
+	if debounceInterval <= 0 {
+		debounceInterval = defaultDebounceInterval
+	}
+
+	logger := log.WithoutContext().WithField(log.ProviderName, providerName)
+
+	// Process events. Bursts of events (e.g. an editor's write-then-rename) are coalesced into a
+	// single callback per debounceInterval, and new/removed subdirectories are (un)watched as they appear.
 	pool.Go(func(stop chan bool) {
 		defer watcher.Close()
+
+		var debounceTimer *time.Timer
+		var pending fsnotify.Event
+		var hasPending bool
+
 		for {
+			var timerC <-chan time.Time
+			if debounceTimer != nil {
+				timerC = debounceTimer.C
+			}
+
 			select {
 			case <-stop:
 				return
+
 			case evt := <-watcher.Events:
 				if p.Directory == "" {
 					var filename string
@@ -114,14 +190,43 @@ func (p *Provider) addWatcher(pool *safe.Pool, directory string, configurationCh
 
 					_, evtFileName := filepath.Split(evt.Name)
 					_, confFileName := filepath.Split(filename)
-					if evtFileName == confFileName {
-						callback(configurationChan, evt)
+					if evtFileName != confFileName {
+						continue
 					}
+				}
+
+				if info, statErr := os.Stat(evt.Name); statErr == nil && info.IsDir() && evt.Op&fsnotify.Create != 0 {
+					if err := addRecursiveWatches(watcher, evt.Name); err != nil {
+						logger.Errorf("Error watching new directory %s: %s", evt.Name, err)
+					}
+				}
+				if evt.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+					_ = watcher.Remove(evt.Name)
+				}
+
+				pending = evt
+				hasPending = true
+				if debounceTimer == nil {
+					debounceTimer = time.NewTimer(debounceInterval)
 				} else {
-					callback(configurationChan, evt)
+					if !debounceTimer.Stop() {
+						select {
+						case <-debounceTimer.C:
+						default:
+						}
+					}
+					debounceTimer.Reset(debounceInterval)
 				}
+
+			case <-timerC:
+				if hasPending {
+					callback(configurationChan, pending)
+					hasPending = false
+				}
+				debounceTimer = nil
+
 			case err := <-watcher.Errors:
-				log.WithoutContext().WithField(log.ProviderName, providerName).Errorf("Watcher event error: %s", err)
+				logger.Errorf("Watcher event error: %s", err)
 			}
 		}
 	})
@@ -145,7 +250,8 @@ func (p *Provider) watcherCallback(configurationChan chan<- config.Message, even
 
 	configuration, err := p.BuildConfiguration()
 	if err != nil {
-		logger.Errorf("Error occurred during watcher callback: %s", err)
+		// Keep serving the last valid configuration rather than pushing a stale/empty one.
+		logger.Errorf("Error occurred during watcher callback, keeping previous configuration: %s", err)
 		return
 	}
 
@@ -171,30 +277,326 @@ func readFile(filename string) (string, error) {
 }
 
 func (p *Provider) loadFileConfig(filename string, parseTemplate bool) (*config.Configuration, error) {
-	fileContent, err := readFile(filename)
+	return p.loadFileConfigWithIncludes(filename, parseTemplate, map[string]struct{}{})
+}
+
+// loadFileConfigWithIncludes loads filename and recursively merges in any files referenced by its
+// top-level "include" directive. visited tracks the absolute paths already being loaded so that an
+// include cycle is reported as an error instead of recursing forever.
+func (p *Provider) loadFileConfigWithIncludes(filename string, parseTemplate bool, visited map[string]struct{}) (*config.Configuration, error) {
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving configuration file path %s: %s", filename, err)
+	}
+	if _, ok := visited[absFilename]; ok {
+		return nil, fmt.Errorf("include cycle detected: %s is already being loaded", filename)
+	}
+	visited[absFilename] = struct{}{}
+	// visited tracks the current include path, not every file ever loaded: a diamond include
+	// (A includes B and C, both of which include a shared base D) is legitimate, so D must be
+	// removed from the path once A's branch through B is done, to allow revisiting it via C.
+	defer delete(visited, absFilename)
+
+	content, err := readFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("error reading configuration file: %s - %s", filename, err)
 	}
 
-	var configuration *config.Configuration
+	configuration, renderedContent, err := p.decodeConfiguration(filename, content, parseTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	if configuration == nil {
+		configuration = &config.Configuration{}
+	}
+	// Allocate each map independently: a file defining only e.g. routers still needs non-nil
+	// Middlewares/Services maps so a later include can merge into them without panicking.
+	if configuration.Routers == nil {
+		configuration.Routers = make(map[string]*config.Router)
+	}
+	if configuration.Middlewares == nil {
+		configuration.Middlewares = make(map[string]*config.Middleware)
+	}
+	if configuration.Services == nil {
+		configuration.Services = make(map[string]*config.Service)
+	}
+
+	includes, err := extractIncludes([]byte(renderedContent), formatFromFilename(filename))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing include directive in %s: %s", filename, err)
+	}
+
+	logger := log.WithoutContext().WithField(log.ProviderName, providerName)
+	for _, pattern := range includes {
+		matches, err := resolveIncludePattern(filename, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving include %q from %s: %s", pattern, filename, err)
+		}
+
+		for _, match := range matches {
+			included, err := p.loadFileConfigWithIncludes(match, true, visited)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.mergeConfiguration(configuration, included, logger); err != nil {
+				return nil, fmt.Errorf("error including %s: %s", match, err)
+			}
+		}
+	}
+
+	return configuration, nil
+}
+
+// decodeConfiguration renders fileContent as a Go template (when parseTemplate is true) and decodes
+// the result using the format inferred from filename's extension. TOML keeps going through
+// CreateConfiguration/DecodeConfiguration so it retains the full template surface (sprig, normalize,
+// ...) and any other provider-specific decoding those already do; other formats are rendered with the
+// same FuncMap and decoded via the shared Unmarshal helper. It also returns the rendered content so
+// callers can scan it for the "include" directive without rendering the template themselves. For a
+// templated TOML file the template is rendered twice here: once inside CreateConfiguration and once
+// more to produce the returned content.
+func (p *Provider) decodeConfiguration(filename, fileContent string, parseTemplate bool) (*config.Configuration, string, error) {
+	format := formatFromFilename(filename)
+	funcMap := p.templateFuncMap(filename)
+
+	if format == formatTOML {
+		if !parseTemplate {
+			configuration, err := p.DecodeConfiguration(fileContent)
+			return configuration, fileContent, err
+		}
+
+		configuration, err := p.CreateConfiguration(fileContent, funcMap, false)
+		if err != nil {
+			return nil, "", err
+		}
+
+		rendered, err := renderTemplate(fileContent, funcMap)
+		if err != nil {
+			return nil, "", fmt.Errorf("error rendering configuration template %s: %s", filename, err)
+		}
+		return configuration, rendered, nil
+	}
+
+	content := fileContent
 	if parseTemplate {
-		configuration, err = p.CreateConfiguration(fileContent, template.FuncMap{}, false)
-	} else {
-		configuration, err = p.DecodeConfiguration(fileContent)
+		rendered, err := renderTemplate(fileContent, funcMap)
+		if err != nil {
+			return nil, "", fmt.Errorf("error rendering configuration template %s: %s", filename, err)
+		}
+		content = rendered
+	}
+
+	configuration := &config.Configuration{}
+	if err := Unmarshal([]byte(content), format, configuration); err != nil {
+		return nil, "", fmt.Errorf("error decoding configuration file %s: %s", filename, err)
 	}
+	return configuration, content, nil
+}
 
+// renderTemplate executes fileContent as a Go template with no additional context.
+func renderTemplate(fileContent string, funcMap template.FuncMap) (string, error) {
+	tmpl, err := template.New("configuration").Funcs(funcMap).Parse(fileContent)
 	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// templateFuncMap assembles the FuncMap made available when rendering a configuration file as a Go
+// template, layering (lowest to highest precedence): sprig's function set plus "normalize" - the same
+// base CreateConfiguration registers, kept here too so the non-TOML decode path has parity with it -
+// then the built-in env/envOrDefault/file/split/join/trim helpers, then p.TemplateFuncs. filename is
+// used to resolve the file helper's relative paths against the configuration file's directory.
+func (p *Provider) templateFuncMap(filename string) template.FuncMap {
+	funcMap := sprig.TxtFuncMap()
+	funcMap["normalize"] = provider.Normalize
+
+	for name, fn := range builtinTemplateFuncs(filepath.Dir(filename)) {
+		funcMap[name] = fn
+	}
+	for name, fn := range p.TemplateFuncs {
+		funcMap[name] = fn
+	}
+	return funcMap
+}
+
+// builtinTemplateFuncs returns the standard set of template helpers for parameterizing
+// configuration files: environment variable lookups, secret files, and string helpers.
+func builtinTemplateFuncs(baseDir string) template.FuncMap {
+	return template.FuncMap{
+		"env": os.Getenv,
+		"envOrDefault": func(key, def string) string {
+			if value, ok := os.LookupEnv(key); ok {
+				return value
+			}
+			return def
+		},
+		"file": func(name string) (string, error) {
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(baseDir, name)
+			}
+			content, err := ioutil.ReadFile(name)
+			if err != nil {
+				return "", fmt.Errorf("error reading file %s: %s", name, err)
+			}
+			return string(content), nil
+		},
+		"split": strings.Split,
+		"join":  strings.Join,
+		"trim":  strings.TrimSpace,
+	}
+}
+
+// formatFromFilename returns the configuration format to use for filename, based on its
+// extension. A trailing ".tmpl" is stripped first so "config.yaml.tmpl" is treated as YAML.
+func formatFromFilename(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == ".tmpl" {
+		ext = strings.ToLower(filepath.Ext(strings.TrimSuffix(filename, ext)))
+	}
+
+	switch ext {
+	case ".yaml", ".yml":
+		return formatYAML
+	case ".json":
+		return formatJSON
+	default:
+		return formatTOML
+	}
+}
+
+// Unmarshal decodes content into v, using the decoder for the given format
+// ("toml", "yaml" or "json").
+func Unmarshal(content []byte, format string, v interface{}) error {
+	switch format {
+	case formatYAML:
+		return yaml.Unmarshal(content, v)
+	case formatJSON:
+		return json.Unmarshal(content, v)
+	case formatTOML:
+		return toml.Unmarshal(content, v)
+	default:
+		return fmt.Errorf("unsupported configuration format: %s", format)
+	}
+}
+
+func hasSupportedExtension(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, supported := range supportedExtensions {
+		if ext == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// includeDirective captures the optional top-level "include" list of a configuration file,
+// without needing to know about the rest of its schema.
+type includeDirective struct {
+	Include []string `toml:"include" yaml:"include" json:"include"`
+}
+
+// extractIncludes reads the "include" directive, if any, out of content.
+func extractIncludes(content []byte, format string) ([]string, error) {
+	var directive includeDirective
+	if err := Unmarshal(content, format, &directive); err != nil {
 		return nil, err
 	}
+	return directive.Include, nil
+}
 
-	if configuration == nil || configuration.Routers == nil && configuration.Middlewares == nil && configuration.Services == nil && configuration.TLS == nil {
-		configuration = &config.Configuration{
-			Routers:     make(map[string]*config.Router),
-			Middlewares: make(map[string]*config.Middleware),
-			Services:    make(map[string]*config.Service),
+// resolveIncludePattern expands pattern into a deterministically sorted list of matching files.
+// A relative pattern is resolved against the directory of includingFile.
+func resolveIncludePattern(includingFile, pattern string) ([]string, error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(includingFile), pattern)
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// mergeConfiguration merges src into dst, resolving duplicate router/middleware/service names
+// according to the configured conflict policy.
+func (p *Provider) mergeConfiguration(dst, src *config.Configuration, logger log.Logger) error {
+	policy := p.conflictPolicy()
+
+	if dst.Routers == nil {
+		dst.Routers = make(map[string]*config.Router)
+	}
+	if dst.Middlewares == nil {
+		dst.Middlewares = make(map[string]*config.Middleware)
+	}
+	if dst.Services == nil {
+		dst.Services = make(map[string]*config.Service)
+	}
+
+	for name, conf := range src.Routers {
+		if _, exists := dst.Routers[name]; exists {
+			switch policy {
+			case ConflictPolicyOverride:
+			case ConflictPolicyError:
+				return fmt.Errorf("router %s is defined more than once", name)
+			default:
+				logger.WithField(log.RouterName, name).Warn("Router already configured, skipping")
+				continue
+			}
+		}
+		dst.Routers[name] = conf
+	}
+
+	for name, conf := range src.Middlewares {
+		if _, exists := dst.Middlewares[name]; exists {
+			switch policy {
+			case ConflictPolicyOverride:
+			case ConflictPolicyError:
+				return fmt.Errorf("middleware %s is defined more than once", name)
+			default:
+				logger.WithField(log.MiddlewareName, name).Warn("Middleware already configured, skipping")
+				continue
+			}
+		}
+		dst.Middlewares[name] = conf
+	}
+
+	for name, conf := range src.Services {
+		if _, exists := dst.Services[name]; exists {
+			switch policy {
+			case ConflictPolicyOverride:
+			case ConflictPolicyError:
+				return fmt.Errorf("service %s is defined more than once", name)
+			default:
+				logger.WithField(log.ServiceName, name).Warn("Service already configured, skipping")
+				continue
+			}
+		}
+		dst.Services[name] = conf
+	}
+
+	existingTLS := make(map[*tls.Configuration]struct{}, len(dst.TLS))
+	for _, conf := range dst.TLS {
+		existingTLS[conf] = struct{}{}
+	}
+	for _, conf := range src.TLS {
+		if _, exists := existingTLS[conf]; exists {
+			logger.Warnf("TLS Configuration %v already configured, skipping", conf)
+			continue
 		}
+		existingTLS[conf] = struct{}{}
+		dst.TLS = append(dst.TLS, conf)
 	}
-	return configuration, err
+
+	return nil
 }
 
 func (p *Provider) loadFileConfigFromDirectory(ctx context.Context, directory string, configuration *config.Configuration) (*config.Configuration, error) {
@@ -214,7 +616,6 @@ func (p *Provider) loadFileConfigFromDirectory(ctx context.Context, directory st
 		}
 	}
 
-	configTLSMaps := make(map[*tls.Configuration]struct{})
 	for _, item := range fileList {
 
 		if item.IsDir() {
@@ -223,7 +624,7 @@ func (p *Provider) loadFileConfigFromDirectory(ctx context.Context, directory st
 				return configuration, fmt.Errorf("unable to load content configuration from subdirectory %s: %v", item, err)
 			}
 			continue
-		} else if !strings.HasSuffix(item.Name(), ".toml") && !strings.HasSuffix(item.Name(), ".tmpl") {
+		} else if !hasSupportedExtension(item.Name()) {
 			continue
 		}
 
@@ -234,41 +635,11 @@ func (p *Provider) loadFileConfigFromDirectory(ctx context.Context, directory st
 			return configuration, err
 		}
 
-		for name, conf := range c.Routers {
-			if _, exists := configuration.Routers[name]; exists {
-				logger.WithField(log.RouterName, name).Warn("Router already configured, skipping")
-			} else {
-				configuration.Routers[name] = conf
-			}
-		}
-
-		for name, conf := range c.Middlewares {
-			if _, exists := configuration.Middlewares[name]; exists {
-				logger.WithField(log.MiddlewareName, name).Warn("Middleware already configured, skipping")
-			} else {
-				configuration.Middlewares[name] = conf
-			}
-		}
-
-		for name, conf := range c.Services {
-			if _, exists := configuration.Services[name]; exists {
-				logger.WithField(log.ServiceName, name).Warn("Service already configured, skipping")
-			} else {
-				configuration.Services[name] = conf
-			}
-		}
-
-		for _, conf := range c.TLS {
-			if _, exists := configTLSMaps[conf]; exists {
-				logger.Warnf("TLS Configuration %v already configured, skipping", conf)
-			} else {
-				configTLSMaps[conf] = struct{}{}
-			}
+		// mergeConfiguration also dedups TLS configurations by pointer identity.
+		if err := p.mergeConfiguration(configuration, c, logger); err != nil {
+			return configuration, fmt.Errorf("unable to load content configuration from %s: %v", item.Name(), err)
 		}
 	}
 
-	for conf := range configTLSMaps {
-		configuration.TLS = append(configuration.TLS, conf)
-	}
 	return configuration, nil
 }
@@ -0,0 +1,247 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/containous/traefik/config"
+	"github.com/containous/traefik/log"
+	"github.com/containous/traefik/tls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/fsnotify.v1"
+)
+
+func TestFormatFromFilename(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		filename string
+		expected string
+	}{
+		{desc: "toml", filename: "dynamic.toml", expected: formatTOML},
+		{desc: "yaml", filename: "dynamic.yaml", expected: formatYAML},
+		{desc: "yml", filename: "dynamic.yml", expected: formatYAML},
+		{desc: "json", filename: "dynamic.json", expected: formatJSON},
+		{desc: "bare tmpl defaults to toml", filename: "dynamic.tmpl", expected: formatTOML},
+		{desc: "yaml tmpl", filename: "dynamic.yaml.tmpl", expected: formatYAML},
+		{desc: "json tmpl", filename: "dynamic.json.tmpl", expected: formatJSON},
+		{desc: "unknown extension defaults to toml", filename: "dynamic.conf", expected: formatTOML},
+		{desc: "uppercase extension", filename: "dynamic.YAML", expected: formatYAML},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, test.expected, formatFromFilename(test.filename))
+		})
+	}
+}
+
+func TestDecodeConfiguration_nonTOML(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		filename string
+		content  string
+	}{
+		{
+			desc:     "yaml",
+			filename: "dynamic.yaml",
+			content:  "routers:\n  my-router: {}\n",
+		},
+		{
+			desc:     "json",
+			filename: "dynamic.json",
+			content:  `{"routers": {"my-router": {}}}`,
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p := &Provider{}
+			configuration, rendered, err := p.decodeConfiguration(test.filename, test.content, false)
+			require.NoError(t, err)
+			assert.Equal(t, test.content, rendered)
+			require.NotNil(t, configuration)
+			assert.Contains(t, configuration.Routers, "my-router")
+		})
+	}
+}
+
+func TestDecodeConfiguration_templatedYAML(t *testing.T) {
+	require.NoError(t, os.Setenv("FILE_TEST_ROUTER_NAME", "templated-router"))
+	defer os.Unsetenv("FILE_TEST_ROUTER_NAME")
+
+	p := &Provider{}
+	content := "routers:\n  {{ env \"FILE_TEST_ROUTER_NAME\" }}: {}\n"
+
+	configuration, rendered, err := p.decodeConfiguration("dynamic.yaml.tmpl", content, true)
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "templated-router")
+	require.NotNil(t, configuration)
+	assert.Contains(t, configuration.Routers, "templated-router")
+}
+
+func TestAddRecursiveWatches(t *testing.T) {
+	root, err := ioutil.TempDir("", "file-provider-recursive-watch")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	sub := filepath.Join(root, "sub")
+	require.NoError(t, os.Mkdir(sub, 0755))
+
+	watcher, err := fsnotify.NewWatcher()
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	require.NoError(t, addRecursiveWatches(watcher, root))
+
+	// A watch on root alone would not see events from sub; addRecursiveWatches must have
+	// registered sub too for this write to be reported.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(sub, "dynamic.yaml"), []byte("routers: {}\n"), 0644))
+
+	select {
+	case evt := <-watcher.Events:
+		assert.Equal(t, filepath.Join(sub, "dynamic.yaml"), evt.Name)
+	case err := <-watcher.Errors:
+		t.Fatalf("unexpected watcher error: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a watch event from the recursively-added subdirectory")
+	}
+}
+
+func TestTemplateFuncMap_Precedence(t *testing.T) {
+	p := &Provider{
+		TemplateFuncs: template.FuncMap{
+			"trim": func(_ string) string { return "overridden-by-user" },
+		},
+	}
+
+	funcMap := p.templateFuncMap("dynamic.yaml.tmpl")
+
+	// sprig is the base layer: functions it provides that we never touch (e.g. "upper") must
+	// still be present.
+	assert.Contains(t, funcMap, "upper")
+	// "normalize" is added to sprig's base layer, below the built-ins, giving the non-TOML path
+	// parity with CreateConfiguration.
+	assert.Contains(t, funcMap, "normalize")
+
+	// The built-in "join" is not overridden by the user, so it wins over anything sprig provides
+	// under the same name.
+	join, ok := funcMap["join"].(func([]string, string) string)
+	require.True(t, ok, "join should be the builtin strings.Join, not sprig's")
+	assert.Equal(t, "a-b", join([]string{"a", "b"}, "-"))
+
+	// p.TemplateFuncs has the highest precedence and overrides even a built-in of the same name.
+	trim, ok := funcMap["trim"].(func(string) string)
+	require.True(t, ok)
+	assert.Equal(t, "overridden-by-user", trim("  x  "))
+}
+
+func writeFixture(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	fullPath := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(fullPath, []byte(content), 0644))
+	return fullPath
+}
+
+func TestLoadFileConfigWithIncludes_DirectCycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file-provider-include-cycle")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a := writeFixture(t, dir, "a.yaml", "include:\n  - a.yaml\n")
+
+	p := &Provider{}
+	_, err = p.loadFileConfig(a, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "include cycle detected")
+}
+
+func TestLoadFileConfigWithIncludes_DiamondInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file-provider-diamond-include")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// a includes both b and c, and b and c both include the shared base d: not a cycle, since d is
+	// never being loaded by one of its own ancestors, only visited twice down separate branches.
+	writeFixture(t, dir, "d.yaml", "routers:\n  from-d: {}\n")
+	writeFixture(t, dir, "b.yaml", "include:\n  - d.yaml\nrouters:\n  from-b: {}\n")
+	writeFixture(t, dir, "c.yaml", "include:\n  - d.yaml\nrouters:\n  from-c: {}\n")
+	a := writeFixture(t, dir, "a.yaml", "include:\n  - b.yaml\n  - c.yaml\n")
+
+	p := &Provider{}
+	configuration, err := p.loadFileConfig(a, false)
+	require.NoError(t, err)
+	assert.Contains(t, configuration.Routers, "from-b")
+	assert.Contains(t, configuration.Routers, "from-c")
+	assert.Contains(t, configuration.Routers, "from-d")
+}
+
+func TestMergeConfiguration_ConflictPolicy(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		policy       string
+		expectErr    bool
+		expectWinner string
+	}{
+		{desc: "default skip keeps the first definition", policy: "", expectWinner: "dst"},
+		{desc: "explicit skip keeps the first definition", policy: ConflictPolicySkip, expectWinner: "dst"},
+		{desc: "override lets the later file win", policy: ConflictPolicyOverride, expectWinner: "src"},
+		{desc: "error fails the merge", policy: ConflictPolicyError, expectErr: true},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+
+			p := &Provider{ConflictPolicy: test.policy}
+			logger := log.WithoutContext().WithField(log.ProviderName, providerName)
+
+			dst := &config.Configuration{
+				Routers: map[string]*config.Router{
+					"my-router": {Service: "dst"},
+				},
+			}
+			src := &config.Configuration{
+				Routers: map[string]*config.Router{
+					"my-router": {Service: "src"},
+				},
+			}
+
+			err := p.mergeConfiguration(dst, src, logger)
+			if test.expectErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expectWinner, dst.Routers["my-router"].Service)
+		})
+	}
+}
+
+func TestMergeConfiguration_TLSDedup(t *testing.T) {
+	p := &Provider{}
+	logger := log.WithoutContext().WithField(log.ProviderName, providerName)
+
+	shared := &tls.Configuration{}
+	onlyInSrc := &tls.Configuration{}
+
+	dst := &config.Configuration{TLS: []*tls.Configuration{shared}}
+	src := &config.Configuration{TLS: []*tls.Configuration{shared, onlyInSrc}}
+
+	require.NoError(t, p.mergeConfiguration(dst, src, logger))
+
+	assert.Len(t, dst.TLS, 2)
+	assert.Contains(t, dst.TLS, shared)
+	assert.Contains(t, dst.TLS, onlyInSrc)
+}